@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"testing"
+
+	vmSchema "kubevirt.io/api/core/v1"
+	domainSchema "kubevirt.io/kubevirt/pkg/virt-launcher/virtwrap/api"
+)
+
+func TestSetRotationRateSATAUsesQEMUOverride(t *testing.T) {
+	domainSpec := &domainSchema.DomainSpec{}
+	disk := &domainSchema.Disk{
+		Target: domainSchema.DiskTarget{Bus: vmSchema.DiskBusSATA},
+		Alias:  &domainSchema.Alias{Name: "sda"},
+	}
+
+	if err := setRotationRate(domainSpec, disk, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if domainSpec.QEMUCmd == nil || len(domainSpec.QEMUCmd.QEMUArg) != 2 {
+		t.Fatalf("expected a qemu -set override, got %+v", domainSpec.QEMUCmd)
+	}
+	want := "device.ua-sda.rotation_rate=1"
+	if got := domainSpec.QEMUCmd.QEMUArg[1].Value; got != want {
+		t.Errorf("QEMUArg = %q, want %q", got, want)
+	}
+}
+
+func TestSetRotationRateVirtioIsNoOp(t *testing.T) {
+	domainSpec := &domainSchema.DomainSpec{}
+	disk := &domainSchema.Disk{
+		Target: domainSchema.DiskTarget{Bus: vmSchema.DiskBusVirtio},
+		Alias:  &domainSchema.Alias{Name: "vda"},
+	}
+
+	if err := setRotationRate(domainSpec, disk, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if domainSpec.QEMUCmd != nil && len(domainSpec.QEMUCmd.QEMUArg) != 0 {
+		t.Errorf("expected no qemu override for virtio, got %+v", domainSpec.QEMUCmd.QEMUArg)
+	}
+	if disk.BlockIO != nil {
+		t.Errorf("expected no BlockIO mutation for virtio, got %+v", disk.BlockIO)
+	}
+}
+
+func TestSetRotationRateRejectsUnsupportedBus(t *testing.T) {
+	domainSpec := &domainSchema.DomainSpec{}
+	disk := &domainSchema.Disk{Target: domainSchema.DiskTarget{Bus: vmSchema.DiskBus("usb")}}
+
+	if err := setRotationRate(domainSpec, disk, 1); err == nil {
+		t.Fatal("expected an error for a bus that does not support rotation_rate")
+	}
+}
+
+func TestSSDBusesFromAnnotationsDefault(t *testing.T) {
+	buses, err := ssdBusesFromAnnotations(map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(buses) != 1 || buses[0] != vmSchema.DiskBusSATA {
+		t.Errorf("buses = %v, want [sata]", buses)
+	}
+}
+
+func TestSSDBusesFromAnnotationsCustomList(t *testing.T) {
+	buses, err := ssdBusesFromAnnotations(map[string]string{ssdBusesAnnotation: "sata, scsi"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !busInList(vmSchema.DiskBusSATA, buses) || !busInList(vmSchema.DiskBusSCSI, buses) {
+		t.Errorf("buses = %v, want sata and scsi", buses)
+	}
+}
+
+func TestSSDBusesFromAnnotationsRejectsUnsupportedBus(t *testing.T) {
+	if _, err := ssdBusesFromAnnotations(map[string]string{ssdBusesAnnotation: "usb"}); err == nil {
+		t.Fatal("expected an error for an unsupported bus")
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"kubevirt.io/client-go/log"
+	cloudinit "kubevirt.io/kubevirt/pkg/cloud-init"
+)
+
+const (
+	cloudConfigHeader = "#cloud-config\n"
+	ssdUdevRulesPath  = "/etc/udev/rules.d/60-ssd-scheduler.rules"
+)
+
+// writeFile mirrors the cloud-init write_files module's entry shape.
+type writeFile struct {
+	Path    string `yaml:"path"`
+	Content string `yaml:"content"`
+}
+
+// injectSSDUdevRules appends a write_files entry seeding ssdUdevRulesPath and a
+// runcmd to reload udev, so the guest reports diskNames as non-rotational
+// instead of relying on QEMU's rotation_rate override alone.
+func injectSSDUdevRules(cloudInitData *cloudinit.CloudInitData, diskNames []string) (*cloudinit.CloudInitData, error) {
+	if len(diskNames) == 0 {
+		return cloudInitData, nil
+	}
+
+	config := map[string]interface{}{}
+	userData := strings.TrimPrefix(cloudInitData.UserData, cloudConfigHeader)
+	if strings.TrimSpace(userData) != "" {
+		if err := yaml.Unmarshal([]byte(userData), &config); err != nil {
+			return nil, fmt.Errorf("failed to parse existing cloud-init user data: %v", err)
+		}
+	}
+
+	writeFiles, _ := config["write_files"].([]interface{})
+	writeFiles = append(writeFiles, writeFile{
+		Path:    ssdUdevRulesPath,
+		Content: ssdUdevRules(diskNames),
+	})
+	config["write_files"] = writeFiles
+
+	runcmd, _ := config["runcmd"].([]interface{})
+	runcmd = append(runcmd, "udevadm control --reload-rules", "udevadm trigger")
+	config["runcmd"] = runcmd
+
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal updated cloud-init user data: %v", err)
+	}
+
+	cloudInitData.UserData = cloudConfigHeader + string(out)
+	log.Log.Info("Injected SSD scheduler udev rules into cloud-init user data")
+	return cloudInitData, nil
+}
+
+// ssdUdevRules renders a udev rule per disk name marking it non-rotational
+// with the mq-deadline scheduler, matched by the guest-visible serial that
+// KubeVirt sets to the disk's name.
+func ssdUdevRules(diskNames []string) string {
+	var b strings.Builder
+	for _, name := range diskNames {
+		fmt.Fprintf(&b, "ACTION==\"add|change\", SUBSYSTEM==\"block\", ENV{ID_SERIAL}==\"%s\", ATTR{queue/rotational}=\"0\", ATTR{queue/scheduler}=\"mq-deadline\"\n", name)
+	}
+	return b.String()
+}
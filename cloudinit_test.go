@@ -0,0 +1,104 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	cloudinit "kubevirt.io/kubevirt/pkg/cloud-init"
+)
+
+func TestInjectSSDUdevRulesNoDisksIsNoOp(t *testing.T) {
+	cloudInitData := &cloudinit.CloudInitData{UserData: "#cloud-config\nhostname: foo\n"}
+
+	got, err := injectSSDUdevRules(cloudInitData, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.UserData != cloudInitData.UserData {
+		t.Errorf("UserData = %q, want unchanged", got.UserData)
+	}
+}
+
+func TestInjectSSDUdevRulesOnEmptyUserData(t *testing.T) {
+	cloudInitData := &cloudinit.CloudInitData{}
+
+	got, err := injectSSDUdevRules(cloudInitData, []string{"sda"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(got.UserData, cloudConfigHeader) {
+		t.Fatalf("UserData = %q, want it to start with %q", got.UserData, cloudConfigHeader)
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(strings.TrimPrefix(got.UserData, cloudConfigHeader)), &config); err != nil {
+		t.Fatalf("result isn't valid YAML: %v", err)
+	}
+
+	writeFiles, _ := config["write_files"].([]interface{})
+	if len(writeFiles) != 1 {
+		t.Fatalf("write_files = %v, want exactly one entry", writeFiles)
+	}
+	entry, _ := writeFiles[0].(map[interface{}]interface{})
+	if entry["path"] != ssdUdevRulesPath {
+		t.Errorf("write_files[0].path = %v, want %q", entry["path"], ssdUdevRulesPath)
+	}
+	if !strings.Contains(entry["content"].(string), `ID_SERIAL}=="sda"`) {
+		t.Errorf("write_files[0].content = %v, want a rule for disk sda", entry["content"])
+	}
+
+	runcmd, _ := config["runcmd"].([]interface{})
+	if len(runcmd) != 2 {
+		t.Fatalf("runcmd = %v, want two entries reloading udev", runcmd)
+	}
+}
+
+func TestInjectSSDUdevRulesPreservesExistingUserData(t *testing.T) {
+	cloudInitData := &cloudinit.CloudInitData{
+		UserData: "#cloud-config\nhostname: foo\nruncmd:\n- echo hello\n",
+	}
+
+	got, err := injectSSDUdevRules(cloudInitData, []string{"vda"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(strings.TrimPrefix(got.UserData, cloudConfigHeader)), &config); err != nil {
+		t.Fatalf("result isn't valid YAML: %v", err)
+	}
+
+	if config["hostname"] != "foo" {
+		t.Errorf("hostname = %v, want existing value preserved", config["hostname"])
+	}
+
+	runcmd, _ := config["runcmd"].([]interface{})
+	if len(runcmd) != 3 {
+		t.Fatalf("runcmd = %v, want the original entry plus two udev reload commands", runcmd)
+	}
+	if runcmd[0] != "echo hello" {
+		t.Errorf("runcmd[0] = %v, want the pre-existing command preserved first", runcmd[0])
+	}
+}
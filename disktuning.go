@@ -0,0 +1,144 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	domainSchema "kubevirt.io/kubevirt/pkg/virt-launcher/virtwrap/api"
+)
+
+// diskTuningAnnotation maps a disk name or bus selector (e.g. "sda" or "sata")
+// to a diskTuning, letting users tune more than just rotation_rate without
+// shipping a dedicated sidecar per qemu/libvirt knob.
+const diskTuningAnnotation = "disks.vm.kubevirt.io/tuning"
+
+// diskTuning captures the per-disk knobs this sidecar knows how to apply. A
+// nil pointer field means "leave as-is"; an empty string field behaves the
+// same way for string-typed knobs.
+type diskTuning struct {
+	RotationRate       *uint  `json:"rotationRate,omitempty"`
+	DiscardGranularity *uint  `json:"discardGranularity,omitempty"`
+	LogicalBlockSize   *uint  `json:"logicalBlockSize,omitempty"`
+	PhysicalBlockSize  *uint  `json:"physicalBlockSize,omitempty"`
+	Cache              string `json:"cache,omitempty"`
+	IO                 string `json:"io,omitempty"`
+	IOEventFD          string `json:"ioeventfd,omitempty"`
+	Queues             *uint  `json:"queues,omitempty"`
+	Discard            string `json:"discard,omitempty"`
+}
+
+// parseDiskTuningAnnotation unmarshals the diskTuningAnnotation value into a
+// selector -> diskTuning map. A missing annotation returns a nil map.
+func parseDiskTuningAnnotation(annotations map[string]string) (map[string]diskTuning, error) {
+	raw, found := annotations[diskTuningAnnotation]
+	if !found {
+		return nil, nil
+	}
+
+	tuning := map[string]diskTuning{}
+	if err := json.Unmarshal([]byte(raw), &tuning); err != nil {
+		return nil, fmt.Errorf("failed to parse %s annotation: %v", diskTuningAnnotation, err)
+	}
+	return tuning, nil
+}
+
+// selectDisks returns the indices into disks matched by selector, which may
+// name a disk alias directly or a disk bus (e.g. "sata", "virtio").
+func selectDisks(disks []domainSchema.Disk, selector string) []int {
+	var matches []int
+	for i, disk := range disks {
+		if disk.Alias != nil && disk.Alias.GetName() == selector {
+			matches = append(matches, i)
+			continue
+		}
+		if strings.EqualFold(string(disk.Target.Bus), selector) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// applyDiskTuning mutates domainSpec according to tuning, validating that
+// every selector matches at least one disk so a typo fails the hook instead
+// of silently producing an unchanged domain.
+func applyDiskTuning(domainSpec *domainSchema.DomainSpec, tuning map[string]diskTuning) error {
+	for selector, t := range tuning {
+		indices := selectDisks(domainSpec.Devices.Disks, selector)
+		if len(indices) == 0 {
+			return fmt.Errorf("%s annotation selector %q matched no disk", diskTuningAnnotation, selector)
+		}
+
+		for _, i := range indices {
+			if err := applyDiskTuningToDisk(domainSpec, &domainSpec.Devices.Disks[i], t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func applyDiskTuningToDisk(domainSpec *domainSchema.DomainSpec, disk *domainSchema.Disk, t diskTuning) error {
+	if t.Cache != "" || t.IO != "" || t.IOEventFD != "" || t.Queues != nil || t.Discard != "" {
+		if disk.Driver == nil {
+			disk.Driver = &domainSchema.DiskDriver{}
+		}
+		if t.Cache != "" {
+			disk.Driver.Cache = t.Cache
+		}
+		if t.IO != "" {
+			disk.Driver.IO = t.IO
+		}
+		if t.IOEventFD != "" {
+			disk.Driver.IOEventFD = t.IOEventFD
+		}
+		if t.Queues != nil {
+			disk.Driver.Queues = t.Queues
+		}
+		if t.Discard != "" {
+			disk.Driver.Discard = t.Discard
+		}
+	}
+
+	if t.LogicalBlockSize != nil || t.PhysicalBlockSize != nil || t.DiscardGranularity != nil {
+		if disk.BlockIO == nil {
+			disk.BlockIO = &domainSchema.BlockIO{}
+		}
+		if t.LogicalBlockSize != nil {
+			disk.BlockIO.LogicalBlockSize = *t.LogicalBlockSize
+		}
+		if t.PhysicalBlockSize != nil {
+			disk.BlockIO.PhysicalBlockSize = *t.PhysicalBlockSize
+		}
+		if t.DiscardGranularity != nil {
+			disk.BlockIO.DiscardGranularity = *t.DiscardGranularity
+		}
+	}
+
+	if t.RotationRate != nil {
+		if err := setRotationRate(domainSpec, disk, *t.RotationRate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
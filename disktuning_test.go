@@ -0,0 +1,101 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	vmSchema "kubevirt.io/api/core/v1"
+	domainSchema "kubevirt.io/kubevirt/pkg/virt-launcher/virtwrap/api"
+)
+
+func testDisks() []domainSchema.Disk {
+	return []domainSchema.Disk{
+		{Alias: &domainSchema.Alias{Name: "sda"}, Target: domainSchema.DiskTarget{Bus: vmSchema.DiskBusSATA}},
+		{Alias: &domainSchema.Alias{Name: "vda"}, Target: domainSchema.DiskTarget{Bus: vmSchema.DiskBusVirtio}},
+		{Alias: &domainSchema.Alias{Name: "vdb"}, Target: domainSchema.DiskTarget{Bus: vmSchema.DiskBusVirtio}},
+	}
+}
+
+func TestSelectDisksByAlias(t *testing.T) {
+	got := selectDisks(testDisks(), "sda")
+	if !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("selectDisks(sda) = %v, want [0]", got)
+	}
+}
+
+func TestSelectDisksByBus(t *testing.T) {
+	got := selectDisks(testDisks(), "virtio")
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("selectDisks(virtio) = %v, want [1 2]", got)
+	}
+}
+
+func TestSelectDisksNoMatch(t *testing.T) {
+	got := selectDisks(testDisks(), "nvme")
+	if len(got) != 0 {
+		t.Errorf("selectDisks(nvme) = %v, want no matches", got)
+	}
+}
+
+func TestParseDiskTuningAnnotationMissing(t *testing.T) {
+	tuning, err := parseDiskTuningAnnotation(map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tuning != nil {
+		t.Errorf("tuning = %v, want nil", tuning)
+	}
+}
+
+func TestParseDiskTuningAnnotationValid(t *testing.T) {
+	annotations := map[string]string{
+		diskTuningAnnotation: `{"sata": {"rotationRate": 1, "cache": "writeback"}}`,
+	}
+	tuning, err := parseDiskTuningAnnotation(annotations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sata, found := tuning["sata"]
+	if !found {
+		t.Fatalf("expected a \"sata\" selector in %v", tuning)
+	}
+	if sata.Cache != "writeback" || sata.RotationRate == nil || *sata.RotationRate != 1 {
+		t.Errorf("tuning[\"sata\"] = %+v, want cache=writeback rotationRate=1", sata)
+	}
+}
+
+func TestParseDiskTuningAnnotationInvalidJSON(t *testing.T) {
+	annotations := map[string]string{diskTuningAnnotation: "not json"}
+	if _, err := parseDiskTuningAnnotation(annotations); err == nil {
+		t.Fatal("expected an error for invalid JSON")
+	}
+}
+
+func TestApplyDiskTuningUnmatchedSelectorFails(t *testing.T) {
+	domainSpec := &domainSchema.DomainSpec{}
+	domainSpec.Devices.Disks = testDisks()
+
+	err := applyDiskTuning(domainSpec, map[string]diskTuning{"nvme": {}})
+	if err == nil {
+		t.Fatal("expected an error for a selector that matches no disk")
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc"
+	"kubevirt.io/client-go/log"
+	"kubevirt.io/kubevirt/pkg/hooks"
+	hooksInfo "kubevirt.io/kubevirt/pkg/hooks/info"
+	hooksV1alpha1 "kubevirt.io/kubevirt/pkg/hooks/v1alpha1"
+	hooksV1alpha2 "kubevirt.io/kubevirt/pkg/hooks/v1alpha2"
+)
+
+func main() {
+	log.InitializeLogging("ssd-hook-sidecar")
+
+	socketPath := filepath.Join(hooks.HookSocketsSharedDirectory, "ssd.sock")
+	socket, err := net.Listen("unix", socketPath)
+	if err != nil {
+		log.Log.Reason(err).Errorf("Failed to initialized socket on path: %s", socketPath)
+		log.Log.Error("Check whether given directory exists and socket name is not already taken by other file")
+		panic(err)
+	}
+	defer os.Remove(socketPath)
+
+	transformer := newSSDTransformer()
+
+	server := grpc.NewServer([]grpc.ServerOption{}...)
+	hooksInfo.RegisterInfoServer(server, infoServer{transformer: transformer})
+	hooksV1alpha1.RegisterCallbacksServer(server, v1alpha1Server{transformer: transformer})
+	hooksV1alpha2.RegisterCallbacksServer(server, v1alpha2Server{transformer: transformer})
+	log.Log.Infof("Starting hook server exposing 'info', 'v1alpha1' and 'v1alpha2' services on socket %s", socketPath)
+	server.Serve(socket)
+}
@@ -24,14 +24,13 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
-	"net"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 
-	"google.golang.org/grpc"
 	vmSchema "kubevirt.io/api/core/v1"
 	"kubevirt.io/client-go/log"
-	"kubevirt.io/kubevirt/pkg/hooks"
+	cloudinit "kubevirt.io/kubevirt/pkg/cloud-init"
 	hooksInfo "kubevirt.io/kubevirt/pkg/hooks/info"
 	hooksV1alpha1 "kubevirt.io/kubevirt/pkg/hooks/v1alpha1"
 	hooksV1alpha2 "kubevirt.io/kubevirt/pkg/hooks/v1alpha2"
@@ -42,35 +41,67 @@ const (
 	ssdDiskAnnotation            = "ssd.vm.kubevirt.io/ssd-patcher"
 	onDefineDomainLoggingMessage = "Hook's OnDefineDomain callback method has been called"
 	qemuv1NS                     = "http://libvirt.org/schemas/domain/qemu/1.0"
+
+	// hookPriorityEnvVar overrides the Priority advertised for every hook
+	// point, letting operators order this sidecar against others (e.g.
+	// smbios, virt-xml) chained onto the same VMI.
+	hookPriorityEnvVar = "HOOK_PRIORITY"
+	// hookPointsEnvVar overrides which hook points this sidecar advertises,
+	// as a comma-separated allowlist of hook point names.
+	hookPointsEnvVar = "HOOK_POINTS"
 )
 
+// defaultHookPointNames are the hook points advertised when hookPointsEnvVar
+// is unset.
+var defaultHookPointNames = []string{
+	hooksInfo.OnDefineDomainHookPointName,
+	hooksInfo.PreCloudInitIsoHookPointName,
+}
+
+// Transformer is the extension point a domain mutation plugs into: the
+// Info/v1alpha1/v1alpha2 gRPC servers below delegate every call to it, so a
+// new mutation only implements this interface. main still opens the hook
+// socket under hooks.HookSocketsSharedDirectory and registers those servers
+// itself; there is no shared runtime that does this for it.
+//
+// Note: we could not confirm a shared "sidecar-shim" runtime package
+// actually exists upstream in this tree (no go.mod/vendor entry references
+// one) and do not vendor any third-party implementation of it, so the gRPC
+// servers below implement that plumbing locally and simply delegate to a
+// registered Transformer rather than importing an unverified package.
+type Transformer interface {
+	Name() string
+	Versions() []string
+	HookPoints() []*hooksInfo.HookPoint
+	OnDefineDomain(vmi *vmSchema.VirtualMachineInstance, domainXML []byte) ([]byte, error)
+	PreCloudInitIso(vmi *vmSchema.VirtualMachineInstance, cloudInitData *cloudinit.CloudInitData) (*cloudinit.CloudInitData, error)
+}
+
 type infoServer struct {
-	Version string
+	transformer Transformer
 }
 
 func (s infoServer) Info(ctx context.Context, params *hooksInfo.InfoParams) (*hooksInfo.InfoResult, error) {
 	log.Log.Info("Hook's Info method has been called")
 
 	return &hooksInfo.InfoResult{
-		Name: "ssd",
-		Versions: []string{
-			s.Version,
-		},
-		HookPoints: []*hooksInfo.HookPoint{
-			{
-				Name:     hooksInfo.OnDefineDomainHookPointName,
-				Priority: 0,
-			},
-		},
+		Name:       s.transformer.Name(),
+		Versions:   s.transformer.Versions(),
+		HookPoints: s.transformer.HookPoints(),
 	}, nil
 }
 
-type v1alpha1Server struct{}
-type v1alpha2Server struct{}
+type v1alpha1Server struct {
+	transformer Transformer
+}
+type v1alpha2Server struct {
+	transformer Transformer
+}
 
 func (s v1alpha2Server) OnDefineDomain(ctx context.Context, params *hooksV1alpha2.OnDefineDomainParams) (*hooksV1alpha2.OnDefineDomainResult, error) {
 	log.Log.Info(onDefineDomainLoggingMessage)
-	newDomainXML, err := onDefineDomain(params.GetVmi(), params.GetDomainXML())
+	vmi := unmarshalVMI(params.GetVmi())
+	newDomainXML, err := s.transformer.OnDefineDomain(vmi, params.GetDomainXML())
 	if err != nil {
 		return nil, err
 	}
@@ -78,15 +109,22 @@ func (s v1alpha2Server) OnDefineDomain(ctx context.Context, params *hooksV1alpha
 		DomainXML: newDomainXML,
 	}, nil
 }
+
 func (s v1alpha2Server) PreCloudInitIso(_ context.Context, params *hooksV1alpha2.PreCloudInitIsoParams) (*hooksV1alpha2.PreCloudInitIsoResult, error) {
+	vmi := unmarshalVMI(params.GetVmi())
+	cloudInitData, err := s.transformer.PreCloudInitIso(vmi, params.GetCloudInitData())
+	if err != nil {
+		return nil, err
+	}
 	return &hooksV1alpha2.PreCloudInitIsoResult{
-		CloudInitData: params.GetCloudInitData(),
+		CloudInitData: cloudInitData,
 	}, nil
 }
 
 func (s v1alpha1Server) OnDefineDomain(ctx context.Context, params *hooksV1alpha1.OnDefineDomainParams) (*hooksV1alpha1.OnDefineDomainResult, error) {
 	log.Log.Info(onDefineDomainLoggingMessage)
-	newDomainXML, err := onDefineDomain(params.GetVmi(), params.GetDomainXML())
+	vmi := unmarshalVMI(params.GetVmi())
+	newDomainXML, err := s.transformer.OnDefineDomain(vmi, params.GetDomainXML())
 	if err != nil {
 		return nil, err
 	}
@@ -95,19 +133,90 @@ func (s v1alpha1Server) OnDefineDomain(ctx context.Context, params *hooksV1alpha
 	}, nil
 }
 
-func onDefineDomain(vmiJSON []byte, domainXML []byte) ([]byte, error) {
+// unmarshalVMI decodes the JSON-encoded VMI every hook callback receives.
+func unmarshalVMI(vmiJSON []byte) *vmSchema.VirtualMachineInstance {
+	vmi := &vmSchema.VirtualMachineInstance{}
+	if err := json.Unmarshal(vmiJSON, vmi); err != nil {
+		log.Log.Reason(err).Errorf("Failed to unmarshal given VMI spec: %s", vmiJSON)
+		panic(err)
+	}
+	return vmi
+}
+
+// ssdTransformer implements Transformer, marking disks on opted-in buses as
+// non-rotational SSDs when a VMI requests it via ssdDiskAnnotation, disk-level
+// tuning via diskTuningAnnotation, and/or free-form XML edits via
+// xmlEditAnnotationPrefix.
+type ssdTransformer struct {
+	version string
+}
+
+func newSSDTransformer() *ssdTransformer {
+	return &ssdTransformer{version: "v1alpha2"}
+}
+
+func (t *ssdTransformer) Name() string {
+	return "ssd"
+}
+
+func (t *ssdTransformer) Versions() []string {
+	return []string{t.version}
+}
+
+// HookPoints builds the HookPoint list to advertise, reading priority and
+// the hook point allowlist from hookPriorityEnvVar/hookPointsEnvVar so
+// operators can place this sidecar relative to others chained onto the same
+// VMI without recompiling it.
+func (t *ssdTransformer) HookPoints() []*hooksInfo.HookPoint {
+	priority := int32(0)
+	if raw := os.Getenv(hookPriorityEnvVar); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil {
+			log.Log.Reason(err).Errorf("Invalid %s value %q, defaulting to priority 0", hookPriorityEnvVar, raw)
+		} else {
+			priority = int32(parsed)
+		}
+	}
+
+	names := defaultHookPointNames
+	if raw := os.Getenv(hookPointsEnvVar); raw != "" {
+		names = nil
+		for _, name := range strings.Split(raw, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	hookPoints := make([]*hooksInfo.HookPoint, 0, len(names))
+	for _, name := range names {
+		hookPoints = append(hookPoints, &hooksInfo.HookPoint{
+			Name:     name,
+			Priority: priority,
+		})
+	}
+	return hookPoints
+}
+
+// OnDefineDomain patches domainXML according to the ssdDiskAnnotation,
+// diskTuningAnnotation and xmlEditAnnotationPrefix annotations found on vmi.
+func (t *ssdTransformer) OnDefineDomain(vmi *vmSchema.VirtualMachineInstance, domainXML []byte) ([]byte, error) {
 	log.Log.Info(onDefineDomainLoggingMessage)
 
-	vmiSpec := vmSchema.VirtualMachineInstance{}
-	err := json.Unmarshal(vmiJSON, &vmiSpec)
+	annotations := vmi.GetAnnotations()
+
+	edits, err := collectXMLEditAnnotations(annotations)
 	if err != nil {
-		log.Log.Reason(err).Errorf("Failed to unmarshal given VMI spec: %s", vmiJSON)
-		panic(err)
+		return nil, fmt.Errorf("failed to parse %s annotations: %v", xmlEditAnnotationPrefix, err)
 	}
 
-	annotations := vmiSpec.GetAnnotations()
+	tuning, err := parseDiskTuningAnnotation(annotations)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, found := annotations[ssdDiskAnnotation]; !found {
+	_, ssdRequested := annotations[ssdDiskAnnotation]
+	if !ssdRequested && len(tuning) == 0 && len(edits) == 0 {
 		log.Log.Info("SM BIOS hook sidecar was requested, but no attributes provided. Returning original domain spec")
 		return domainXML, nil
 	}
@@ -124,22 +233,38 @@ func onDefineDomain(vmiJSON []byte, domainXML []byte) ([]byte, error) {
 		domainSpec.QEMUCmd = &domainSchema.Commandline{}
 	}
 
-	// for all sata disks in the domain spec, append the arguments to set them as sata disks
-	for _, v := range domainSpec.Devices.Disks {
-		log.Log.Infof("%v", v.Target.Bus)
-		content, err := json.Marshal(v)
+	if ssdRequested {
+		ssdBuses, err := ssdBusesFromAnnotations(annotations)
 		if err != nil {
-			return nil, nil
+			return nil, err
 		}
-		log.Log.Info(string(content))
-		if v.Target.Bus == vmSchema.DiskBusSATA {
-			domainSpec.QEMUCmd.QEMUArg = append(domainSpec.QEMUCmd.QEMUArg, domainSchema.Arg{Value: "-set"}, domainSchema.Arg{Value: fmt.Sprintf("device.ua-%s.rotation_rate=1", v.Alias.DeepCopy().GetName())})
+
+		// mark every disk on an opted-in bus as non-rotational
+		for i, v := range domainSpec.Devices.Disks {
+			if busInList(v.Target.Bus, ssdBuses) {
+				if err := setRotationRate(&domainSpec, &domainSpec.Devices.Disks[i], 1); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if len(tuning) > 0 {
+		if err := applyDiskTuning(&domainSpec, tuning); err != nil {
+			return nil, err
 		}
 	}
 
 	if len(domainSpec.QEMUCmd.QEMUArg) > 0 {
 		domainSpec.XmlNS = qemuv1NS
 	}
+
+	patchedSpec, err := applyXMLEdits(&domainSpec, edits)
+	if err != nil {
+		return nil, err
+	}
+	domainSpec = *patchedSpec
+
 	newDomainXML, err := xml.Marshal(domainSpec)
 	if err != nil {
 		log.Log.Reason(err).Errorf("Failed to marshal updated domain spec: %+v", domainSpec)
@@ -151,22 +276,29 @@ func onDefineDomain(vmiJSON []byte, domainXML []byte) ([]byte, error) {
 	return newDomainXML, nil
 }
 
-func main() {
-	log.InitializeLogging("ssd-hook-sidecar")
+// PreCloudInitIso seeds udev rules for every disk the ssdDiskAnnotation
+// marks as SSD, so the guest reports them as non-rotational instead of
+// relying on QEMU's rotation_rate override alone.
+func (t *ssdTransformer) PreCloudInitIso(vmi *vmSchema.VirtualMachineInstance, cloudInitData *cloudinit.CloudInitData) (*cloudinit.CloudInitData, error) {
+	annotations := vmi.GetAnnotations()
+	if _, found := annotations[ssdDiskAnnotation]; !found {
+		return cloudInitData, nil
+	}
 
-	socketPath := filepath.Join(hooks.HookSocketsSharedDirectory, "ssd.sock")
-	socket, err := net.Listen("unix", socketPath)
+	ssdBuses, err := ssdBusesFromAnnotations(annotations)
 	if err != nil {
-		log.Log.Reason(err).Errorf("Failed to initialized socket on path: %s", socket)
-		log.Log.Error("Check whether given directory exists and socket name is not already taken by other file")
-		panic(err)
+		return nil, err
+	}
+
+	var ssdDiskNames []string
+	for _, d := range vmi.Spec.Domain.Devices.Disks {
+		if d.DiskDevice.Disk == nil {
+			continue
+		}
+		if busInList(d.DiskDevice.Disk.Bus, ssdBuses) {
+			ssdDiskNames = append(ssdDiskNames, d.Name)
+		}
 	}
-	defer os.Remove(socketPath)
 
-	server := grpc.NewServer([]grpc.ServerOption{}...)
-	hooksInfo.RegisterInfoServer(server, infoServer{Version: "v1alpha2"})
-	hooksV1alpha1.RegisterCallbacksServer(server, v1alpha1Server{})
-	hooksV1alpha2.RegisterCallbacksServer(server, v1alpha2Server{})
-	log.Log.Infof("Starting hook server exposing 'info' and 'v1alpha2' services on socket %s", socketPath)
-	server.Serve(socket)
+	return injectSSDUdevRules(cloudInitData, ssdDiskNames)
 }
@@ -0,0 +1,182 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kubevirt.io/client-go/log"
+	domainSchema "kubevirt.io/kubevirt/pkg/virt-launcher/virtwrap/api"
+)
+
+// xmlEditAnnotationPrefix is the annotation family used to request virt-xml-style
+// edits against the domain, e.g. "xml.vm.kubevirt.io/edit-0" = "--edit target=sda
+// --disk rotation_rate=1". The numeric suffix fixes application order when several
+// edits are requested.
+const xmlEditAnnotationPrefix = "xml.vm.kubevirt.io/edit-"
+
+// virtXMLPath is the binary invoked to apply edits that have no direct
+// representation in domainSchema.DomainSpec.
+const virtXMLPath = "virt-xml"
+
+// collectXMLEditAnnotations returns the values of every xmlEditAnnotationPrefix
+// annotation, ordered by their numeric suffix.
+func collectXMLEditAnnotations(annotations map[string]string) ([]string, error) {
+	type indexedEdit struct {
+		index int
+		value string
+	}
+
+	var indexed []indexedEdit
+	for key, value := range annotations {
+		suffix, found := strings.CutPrefix(key, xmlEditAnnotationPrefix)
+		if !found {
+			continue
+		}
+		index, err := strconv.Atoi(suffix)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %q must end in an integer index: %v", key, err)
+		}
+		indexed = append(indexed, indexedEdit{index: index, value: value})
+	}
+
+	sort.Slice(indexed, func(i, j int) bool { return indexed[i].index < indexed[j].index })
+
+	edits := make([]string, len(indexed))
+	for i, e := range indexed {
+		edits[i] = e.value
+	}
+	return edits, nil
+}
+
+// applyXMLEdits runs each virt-xml-like edit expression against domainSpec in
+// order, shelling out to virt-xml since edits such as "--add-device",
+// "--remove-device" and free-form "--edit" selectors aren't all representable by
+// domainSchema.DomainSpec.
+func applyXMLEdits(domainSpec *domainSchema.DomainSpec, edits []string) (*domainSchema.DomainSpec, error) {
+	if len(edits) == 0 {
+		return domainSpec, nil
+	}
+
+	currentXML, err := xml.Marshal(domainSpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal domain spec ahead of xml edits: %v", err)
+	}
+
+	for _, edit := range edits {
+		log.Log.Infof("applying xml edit annotation: %s", edit)
+		currentXML, err = runVirtXMLEdit(currentXML, edit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply xml edit %q: %v", edit, err)
+		}
+	}
+
+	patched := &domainSchema.DomainSpec{}
+	if err := xml.Unmarshal(currentXML, patched); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal domain spec after xml edits: %v", err)
+	}
+	return patched, nil
+}
+
+// runVirtXMLEdit applies a single edit expression (e.g. "--edit target=sda
+// --disk rotation_rate=1" or "--edit --cpu host-passthrough,clearxml=no") to
+// domainXML and returns the resulting XML.
+func runVirtXMLEdit(domainXML []byte, edit string) ([]byte, error) {
+	tmpFile, err := os.CreateTemp("", "ssd-hook-domain-*.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary domain file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(domainXML); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("failed to write temporary domain file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close temporary domain file: %v", err)
+	}
+
+	editArgs, err := splitEditArgs(edit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize edit expression %q: %v", edit, err)
+	}
+
+	args := append([]string{"--original-xml", tmpFile.Name(), "--print-xml"}, editArgs...)
+	cmd := exec.Command(virtXMLPath, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", virtXMLPath, strings.Join(args, " "), err, stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// splitEditArgs tokenizes a virt-xml edit expression on whitespace, treating
+// single- and double-quoted spans as a single argument (with the quotes
+// stripped) so values like --metadata description="My VM" survive as one
+// token instead of being split on the embedded space.
+func splitEditArgs(edit string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	hasToken := false
+	var quote rune
+
+	flush := func() {
+		if hasToken {
+			args = append(args, current.String())
+			current.Reset()
+			hasToken = false
+		}
+	}
+
+	for _, r := range edit {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			hasToken = true
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			current.WriteRune(r)
+			hasToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	flush()
+
+	return args, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollectXMLEditAnnotationsOrdersByIndex(t *testing.T) {
+	annotations := map[string]string{
+		xmlEditAnnotationPrefix + "2": "--edit --cpu host-passthrough,clearxml=no",
+		xmlEditAnnotationPrefix + "0": "--edit target=sda --disk rotation_rate=1",
+		xmlEditAnnotationPrefix + "1": "--add-device --disk /var/run/extra.img",
+		"unrelated.vm.kubevirt.io/foo": "ignored",
+	}
+
+	edits, err := collectXMLEditAnnotations(annotations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"--edit target=sda --disk rotation_rate=1",
+		"--add-device --disk /var/run/extra.img",
+		"--edit --cpu host-passthrough,clearxml=no",
+	}
+	if !reflect.DeepEqual(edits, want) {
+		t.Errorf("edits = %v, want %v", edits, want)
+	}
+}
+
+func TestCollectXMLEditAnnotationsRejectsNonIntegerSuffix(t *testing.T) {
+	annotations := map[string]string{xmlEditAnnotationPrefix + "first": "--edit target=sda"}
+	if _, err := collectXMLEditAnnotations(annotations); err == nil {
+		t.Fatal("expected an error for a non-integer suffix")
+	}
+}
+
+func TestEditTokenizationIsQuoteAware(t *testing.T) {
+	got, err := splitEditArgs(`--metadata description="My VM" --edit target=sda`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"--metadata", "description=My VM", "--edit", "target=sda"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitEditArgs = %v, want %v", got, want)
+	}
+}
+
+func TestSplitEditArgsRejectsUnterminatedQuote(t *testing.T) {
+	if _, err := splitEditArgs(`--metadata description="My VM`); err == nil {
+		t.Fatal("expected an error for an unterminated quote")
+	}
+}